@@ -9,11 +9,21 @@ import "io"
 type Backend interface {
 	io.ReaderAt
 
+	// WriteAt writes len(p) bytes starting at off.
+	WriteAt(p []byte, off int64) (int, error)
+
+	// Zero marks length bytes starting at off as zero, without transferring
+	// the zero bytes.
+	Zero(off, length uint64) error
+
+	// Flush writes all buffered data to storage.
+	Flush() error
+
 	// Size return the size of the underlying disk image.
 	Size() (uint64, error)
 
-	// Extents return image extents.
-	Extents() (ExtentsResult, error)
+	// Extents returns the extents overlapping [offset, offset+length).
+	Extents(offset, length uint64) (ExtentsResult, error)
 
 	// Close the backend.
 	Close()
@@ -18,7 +18,7 @@ type Extent struct {
 
 // NewExtent creates a new Extent.
 func NewExtent(start uint64, length uint64, zero bool) *Extent {
-	return &Extent{start, length, zero}
+	return &Extent{Start: start, Length: length, Zero: zero}
 }
 
 // ExtentsResult iterates over extents.
@@ -27,27 +27,92 @@ type ExtentsResult interface {
 	Next() bool
 	// Value returns the next extent.
 	Value() *Extent
+	// Seek repositions the iterator so the next call to Next/Value resumes
+	// at offset, letting callers restart mid-stream or split a range across
+	// workers without re-creating the result from scratch.
+	Seek(offset uint64) error
 }
 
-// ExtentsWraper wrapps []*Extent to provied the ExtentsResult interface.
+// ExtentsWrapper wraps a []*Extent, already clipped to the requested
+// range, to provide the ExtentsResult interface.
 type ExtentsWrapper struct {
-	extents []*Extent
-	next    int
+	all    []*Extent
+	window []*Extent
+	next   int
+
+	// hasEnd and end describe the absolute end of the requested window, set
+	// once at construction. Seek must clip to this same end regardless of
+	// where it repositions the start, so it cannot be derived from a
+	// relative length that only made sense at the original offset.
+	hasEnd bool
+	end    uint64
 }
 
-// NewExtentsWrapper create new wrapper.
+// NewExtentsWrapper creates a wrapper iterating over all of e.
 func NewExtentsWrapper(e []*Extent) *ExtentsWrapper {
-	return &ExtentsWrapper{extents: e}
+	return &ExtentsWrapper{all: e, window: e}
+}
+
+// NewExtentsWrapperRange creates a wrapper iterating over the part of e
+// overlapping [offset, offset+length). A length of 0 means to the end of e.
+func NewExtentsWrapperRange(e []*Extent, offset, length uint64) *ExtentsWrapper {
+	w := &ExtentsWrapper{all: e, hasEnd: length > 0, end: offset + length}
+	w.Seek(offset)
+	return w
 }
 
 // Next returns true if there are move extents.
 func (w *ExtentsWrapper) Next() bool {
-	return w.next < len(w.extents)
+	return w.next < len(w.window)
 }
 
 // Value returns the next extent.
 func (w *ExtentsWrapper) Value() *Extent {
-	v := w.extents[w.next]
+	v := w.window[w.next]
 	w.next++
 	return v
 }
+
+// Seek repositions the iterator at offset, re-clipping to [offset, end),
+// where end is the absolute end of the range given when the wrapper was
+// created.
+func (w *ExtentsWrapper) Seek(offset uint64) error {
+	w.window = clipExtents(w.all, offset, w.hasEnd, w.end)
+	w.next = 0
+	return nil
+}
+
+// clipExtents returns the extents in all overlapping [offset, end), clipping
+// the first and last extent as needed. hasEnd false means unbounded, to the
+// end of all.
+func clipExtents(all []*Extent, offset uint64, hasEnd bool, end uint64) []*Extent {
+	var out []*Extent
+	for _, e := range all {
+		extentEnd := e.Start + e.Length
+		if extentEnd <= offset {
+			continue
+		}
+		if hasEnd && e.Start >= end {
+			break
+		}
+
+		start := e.Start
+		if start < offset {
+			start = offset
+		}
+		stop := extentEnd
+		if hasEnd && stop > end {
+			stop = end
+		}
+		if stop <= start {
+			continue
+		}
+
+		clipped := *e
+		clipped.Start = start
+		clipped.Length = stop - start
+		out = append(out, &clipped)
+	}
+
+	return out
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package imageio
+
+import "testing"
+
+func values(r ExtentsResult) []*Extent {
+	var out []*Extent
+	for r.Next() {
+		out = append(out, r.Value())
+	}
+	return out
+}
+
+func TestExtentsWrapperRangeClips(t *testing.T) {
+	e := []*Extent{NewExtent(0, 2000, false)}
+
+	w := NewExtentsWrapperRange(e, 100, 500)
+	got := values(w)
+
+	if len(got) != 1 || got[0].Start != 100 || got[0].Length != 500 {
+		t.Fatalf("values() = %+v, expected a single [100,600) extent", got)
+	}
+}
+
+func TestExtentsWrapperSeekPreservesWindowEnd(t *testing.T) {
+	e := []*Extent{NewExtent(0, 2000, false)}
+
+	w := NewExtentsWrapperRange(e, 100, 500)
+	if err := w.Seek(300); err != nil {
+		t.Fatalf("Seek failed: %s", err)
+	}
+
+	got := values(w)
+	if len(got) != 1 || got[0].Start != 300 || got[0].Length != 300 {
+		t.Fatalf("values() = %+v, expected a single [300,600) extent", got)
+	}
+}
+
+func TestExtentsWrapperUnboundedSeek(t *testing.T) {
+	e := []*Extent{
+		NewExtent(0, 100, false),
+		NewExtent(100, 100, true),
+	}
+
+	w := NewExtentsWrapper(e)
+	if err := w.Seek(50); err != nil {
+		t.Fatalf("Seek failed: %s", err)
+	}
+
+	got := values(w)
+	if len(got) != 2 || got[0].Start != 50 || got[0].Length != 50 || got[1].Start != 100 || got[1].Length != 100 {
+		t.Fatalf("values() = %+v, expected [50,100) and [100,200)", got)
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// ServerCapabilities describes the features and limits advertised by an
+// imageio server in response to an OPTIONS request.
+type ServerCapabilities struct {
+	// Features lists the operations the server supports, for example
+	// "zero", "flush", "extents" or "unix_socket".
+	Features []string `json:"features"`
+
+	// MaxReaders is the maximum number of concurrent read connections the
+	// server accepts for this ticket. Zero means unknown.
+	MaxReaders int `json:"max_readers"`
+
+	// MaxWriters is the maximum number of concurrent write connections the
+	// server accepts for this ticket. Zero means unknown.
+	MaxWriters int `json:"max_writers"`
+
+	// Size is the size of the image in bytes, when advertised by the
+	// server. Nil when the server does not expose it in OPTIONS.
+	Size *uint64 `json:"size,omitempty"`
+}
+
+// Has returns true if the server advertises feature.
+func (c *ServerCapabilities) Has(feature string) bool {
+	for _, f := range c.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities returns the capabilities advertised by the server at connect
+// time, or a zero value ServerCapabilities if the server did not respond to
+// the OPTIONS request (for example, an older server).
+func (b *Backend) Capabilities() ServerCapabilities {
+	return b.caps
+}
+
+// MaxReaders returns the server's advertised read concurrency limit, or 0
+// if unknown. It lets transfer.Copy size its worker pool automatically.
+func (b *Backend) MaxReaders() int {
+	return b.caps.MaxReaders
+}
+
+// MaxWriters returns the server's advertised write concurrency limit, or 0
+// if unknown. It lets transfer.Copy size its worker pool automatically.
+func (b *Backend) MaxWriters() int {
+	return b.caps.MaxWriters
+}
+
+// SupportsCopy returns true if the server advertises the "copy" feature, so
+// CopyAt can be used to duplicate already written bytes without
+// retransferring them.
+func (b *Backend) SupportsCopy() bool {
+	return b.caps.Has("copy")
+}
+
+// getCapabilities issues an OPTIONS request and returns the parsed
+// ServerCapabilities. Servers that do not implement OPTIONS yet return a
+// zero value instead of an error, so Connect keeps working against them.
+func (b *Backend) getCapabilities() (ServerCapabilities, error) {
+	req, err := http.NewRequest(http.MethodOptions, b.url, nil)
+	if err != nil {
+		return ServerCapabilities{}, err
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return ServerCapabilities{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return ServerCapabilities{}, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return ServerCapabilities{}, nil
+	}
+
+	var caps ServerCapabilities
+	if err := json.Unmarshal(body, &caps); err != nil {
+		return ServerCapabilities{}, nil
+	}
+
+	return caps, nil
+}
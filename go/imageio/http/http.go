@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+// Package http implements an imageio.Backend exposing a disk image served
+// by the imageio server over HTTPS.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"ovirt.org/imageio"
+)
+
+// Backend exposes a disk image served by imageio server on a oVirt host.
+type Backend struct {
+	url     string
+	opts    Options
+	client  *http.Client
+	caps    ServerCapabilities
+	size    uint64
+	extents []*imageio.Extent
+}
+
+// Connect returns a connected Backend, verifying the server certificate
+// against the system's trusted CA roots (or the oVirt engine CA when the
+// URL host looks like an engine host). Caller should close the backend when
+// done.
+func Connect(url string) (*Backend, error) {
+	return ConnectWithOptions(url, Options{})
+}
+
+// ConnectWithOptions is like Connect, but lets the caller configure CA
+// pinning, mutual TLS and SPKI pinning via opts.
+func ConnectWithOptions(url string, opts Options) (*Backend, error) {
+	tlsConfig, err := newTLSConfig(url, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig: tlsConfig,
+
+		// Increass throughput from 400 MiB/s to 1.3 GiB/s
+		// https://go-review.googlesource.com/c/go/+/76410.
+		WriteBufferSize: 128 * 1024,
+
+		// TODO: connection and read timeouts.
+	}
+	client := &http.Client{Transport: tr}
+
+	b := &Backend{url: url, opts: opts, client: client}
+
+	caps, err := b.getCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	b.caps = caps
+	if caps.Size != nil {
+		b.size = *caps.Size
+	}
+
+	return b, nil
+}
+
+// Clone opens another, independent connection to the same imageio server,
+// reusing the same TLS options. This lets a transfer worker own its
+// connection instead of sharing one across goroutines.
+func (b *Backend) Clone() (imageio.Backend, error) {
+	return ConnectWithOptions(b.url, b.opts)
+}
+
+// Size return image size.
+func (b *Backend) Size() (uint64, error) {
+	if b.size == 0 {
+		// The server did not advertise the size of the image in the OPTIONS
+		// response. The only way to get size is to get all the extents and
+		// compute the size from the last extent.
+		err := b.getExtents()
+		if err != nil {
+			return 0, err
+		}
+		last := b.extents[len(b.extents)-1]
+		b.size = last.Start + last.Length
+	}
+	return b.size, nil
+}
+
+// Extents returns the extents overlapping [offset, offset+length). Imageio
+// server does not support getting partial extents yet, so the full image
+// extents are always fetched and then clipped to the requested range. When
+// the server does not advertise the "extents" feature, a single non-zero
+// extent covering the whole image is synthesized instead. This needs the
+// image size: if OPTIONS did not advertise it, Size fetches /extents and
+// Extents fails when that request fails.
+func (b *Backend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	if len(b.extents) == 0 {
+		if !b.caps.Has("extents") {
+			size, err := b.Size()
+			if err != nil {
+				return nil, err
+			}
+			return imageio.NewExtentsWrapperRange([]*imageio.Extent{
+				imageio.NewExtent(0, size, false),
+			}, offset, length), nil
+		}
+		if err := b.getExtents(); err != nil {
+			return nil, err
+		}
+	}
+	return imageio.NewExtentsWrapperRange(b.extents, offset, length), nil
+}
+
+// ReadAt reads len(p) bytes starting at off using a ranged GET request.
+func (b *Backend) ReadAt(p []byte, off int64) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, b.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusPartialContent && res.StatusCode != http.StatusOK {
+		return 0, readServerError(res)
+	}
+
+	n, err := io.ReadFull(res.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		// The server returned less than requested because the range reached
+		// the end of the image.
+		err = io.EOF
+	}
+	return n, err
+}
+
+// WriteAt writes len(p) bytes starting at off using a PUT request with a
+// Content-Range header, as expected by imageio's upload API.
+func (b *Backend) WriteAt(p []byte, off int64) (int, error) {
+	req, err := http.NewRequest(http.MethodPut, b.url, bytes.NewReader(p))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = int64(len(p))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", off, off+int64(len(p))-1))
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, readServerError(res)
+	}
+
+	io.Copy(io.Discard, res.Body)
+	return len(p), nil
+}
+
+// Zero marks length bytes starting at off as zero using a PATCH request,
+// without transferring the zero bytes.
+func (b *Backend) Zero(off, length uint64) error {
+	return b.patch(map[string]interface{}{
+		"op":     "zero",
+		"offset": off,
+		"size":   length,
+	})
+}
+
+// Flush writes all buffered data to storage using a PATCH request.
+func (b *Backend) Flush() error {
+	return b.patch(map[string]interface{}{"op": "flush"})
+}
+
+// CopyAt asks the server to duplicate length bytes it already has at
+// srcOffset to dstOffset, without retransferring them. Callers should check
+// SupportsCopy first; the server may reject the request otherwise.
+func (b *Backend) CopyAt(dstOffset, length, srcOffset uint64) error {
+	return b.patch(map[string]interface{}{
+		"op":         "copy",
+		"offset":     dstOffset,
+		"size":       length,
+		"src_offset": srcOffset,
+	})
+}
+
+func (b *Backend) patch(msg map[string]interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, b.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return readServerError(res)
+	}
+
+	io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// Close closes the connection to imageio server.
+func (b *Backend) Close() {
+	b.client.CloseIdleConnections()
+}
+
+func (b *Backend) getExtents() error {
+	res, err := b.client.Get(b.url + "/extents")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return readServerError(res)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("Cannot get extents: %s", err)
+	}
+
+	err = json.Unmarshal(body, &b.extents)
+	if err != nil {
+		return fmt.Errorf("Cannot get extents: %s", err)
+	}
+
+	return nil
+}
+
+func readServerError(res *http.Response) error {
+	reason, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading response: %s", err)
+	}
+	return fmt.Errorf("Server error: %s", reason)
+}
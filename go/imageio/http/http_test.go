@@ -90,7 +90,8 @@ func TestHTTPExtents(t *testing.T) {
 	}
 	defer b.Close()
 
-	res, err := b.Extents()
+	imageSize := 6 * units.GiB
+	res, err := b.Extents(0, imageSize)
 	if err != nil {
 		t.Fatalf("Extents() failed: %s", err)
 	}
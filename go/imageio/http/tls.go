@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+)
+
+// defaultEngineCAFile is the standard location of the oVirt engine CA
+// certificate on a host enrolled with the engine.
+const defaultEngineCAFile = "/etc/pki/ovirt-engine/ca.pem"
+
+// Options configures the TLS connection used by ConnectWithOptions.
+type Options struct {
+	// CAFile is a PEM file with the CA certificates trusted to verify the
+	// server certificate. If empty and the URL host looks like an oVirt
+	// engine host, defaultEngineCAFile is used when it exists. Otherwise
+	// the system's trusted roots are used.
+	CAFile string
+
+	// CAPEM is a PEM encoded CA certificate, used instead of reading CAFile.
+	CAPEM []byte
+
+	// ServerName overrides the server name used for verification and SNI.
+	// Defaults to the URL host.
+	ServerName string
+
+	// ClientCert and ClientKey are PEM files with a client certificate and
+	// key used for mutual TLS. Both must be set to enable mTLS.
+	ClientCert string
+	ClientKey  string
+
+	// SPKIPin, when set, is the base64 encoded SHA-256 digest of the server
+	// certificate's SubjectPublicKeyInfo. The connection is rejected unless
+	// a certificate presented by the server matches this pin.
+	SPKIPin string
+}
+
+// newTLSConfig builds the tls.Config used to connect to rawURL according to
+// opts.
+func newTLSConfig(rawURL string, opts Options) (*tls.Config, error) {
+	host, err := hostOf(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := certPool(host, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		ServerName: opts.ServerName,
+		RootCAs:    pool,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.SPKIPin != "" {
+		cfg.VerifyPeerCertificate = verifySPKIPin(opts.SPKIPin)
+	}
+
+	return cfg, nil
+}
+
+// certPool returns the CA pool to verify the server certificate with, or
+// nil to use the system's trusted roots.
+func certPool(host string, opts Options) (*x509.CertPool, error) {
+	pem := opts.CAPEM
+
+	if pem == nil {
+		caFile := opts.CAFile
+		if caFile == "" && looksLikeEngine(host) {
+			if _, err := os.Stat(defaultEngineCAFile); err == nil {
+				caFile = defaultEngineCAFile
+			}
+		}
+		if caFile == "" {
+			return nil, nil
+		}
+
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file %q: %s", caFile, err)
+		}
+		pem = data
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA data")
+	}
+	return pool, nil
+}
+
+// looksLikeEngine returns true when host is a named host rather than
+// localhost or an IP literal, the common shape of an oVirt engine address.
+func looksLikeEngine(host string) bool {
+	if host == "localhost" {
+		return false
+	}
+	return net.ParseIP(host) == nil
+}
+
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse URL %q: %s", rawURL, err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid URL %q: missing host", rawURL)
+	}
+	return u.Hostname(), nil
+}
+
+// verifySPKIPin returns a tls.Config.VerifyPeerCertificate callback
+// rejecting the connection unless one of the presented certificates'
+// SubjectPublicKeyInfo matches pin.
+func verifySPKIPin(pin string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if base64.StdEncoding.EncodeToString(sum[:]) == pin {
+				return nil
+			}
+		}
+		return fmt.Errorf("server certificate does not match pinned key %q", pin)
+	}
+}
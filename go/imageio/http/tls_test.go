@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package http
+
+import "testing"
+
+func TestLooksLikeEngine(t *testing.T) {
+	cases := map[string]bool{
+		"localhost":          false,
+		"127.0.0.1":          false,
+		"::1":                false,
+		"engine.example.com": true,
+	}
+	for host, want := range cases {
+		if got := looksLikeEngine(host); got != want {
+			t.Errorf("looksLikeEngine(%q) = %v, expected %v", host, got, want)
+		}
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	host, err := hostOf("https://engine.example.com:54322/images/nbd")
+	if err != nil {
+		t.Fatalf("hostOf failed: %s", err)
+	}
+	if host != "engine.example.com" {
+		t.Errorf("hostOf() = %q, expected %q", host, "engine.example.com")
+	}
+
+	if _, err := hostOf("://bad-url"); err == nil {
+		t.Error("hostOf() on invalid URL did not fail")
+	}
+}
+
+func TestCertPoolInvalidPEM(t *testing.T) {
+	_, err := certPool("engine.example.com", Options{CAPEM: []byte("not a certificate")})
+	if err == nil {
+		t.Error("certPool() with invalid PEM did not fail")
+	}
+}
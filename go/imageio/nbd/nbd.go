@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package nbd
+
+import (
+	"syscall"
+
+	"libguestfs.org/libnbd"
+	"ovirt.org/imageio"
+	"ovirt.org/imageio/units"
+)
+
+const (
+	// The NBD protocol allows up to 2**32 - 1 (4 GiB), but large requests can
+	// be slow, so we limit the size.
+	maxExtent = 1 * units.GiB
+)
+
+// Backend exposes a disk image served by a Network Block Device (NBD) server.
+type Backend struct {
+	h    *libnbd.Libnbd
+	size uint64
+
+	// Kept to allow Clone() to open another, independent connection to the
+	// same export.
+	url           string
+	file, fileFmt string
+	fileReadOnly  bool
+}
+
+// ConnectFile runs a read-only qemu-nbd on filename and returns a connected
+// Backend. qemu-nbd will be terminated when the backend is closed.
+func ConnectFile(filename, format string) (*Backend, error) {
+	return connectFile(filename, format, true)
+}
+
+// ConnectFileWritable is like ConnectFile, but opens filename for reading and
+// writing, for use as a transfer destination.
+func ConnectFileWritable(filename, format string) (*Backend, error) {
+	return connectFile(filename, format, false)
+}
+
+func connectFile(filename, format string, readOnly bool) (*Backend, error) {
+	h, err := libnbd.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.AddMetaContext("base:allocation")
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	args := []string{"qemu-nbd"}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	args = append(args,
+		"--persistent",
+		"--shared", "8",
+		"--format", format,
+		filename,
+	)
+
+	err = h.ConnectSystemdSocketActivation(args)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	size, err := h.GetSize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		h: h, size: size,
+		file: filename, fileFmt: format, fileReadOnly: readOnly,
+	}, nil
+}
+
+// Connect returns a connected Backend. Caller should close the backend when
+// done.
+func Connect(url string) (*Backend, error) {
+	h, err := libnbd.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.AddMetaContext("base:allocation")
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	err = h.ConnectUri(url)
+	if err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	size, err := h.GetSize()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{h: h, size: size, url: url}, nil
+}
+
+// Clone opens another, independent connection to the same export, using a
+// private libnbd handle. This lets a transfer worker own its connection
+// instead of sharing one across goroutines.
+func (b *Backend) Clone() (imageio.Backend, error) {
+	if b.url != "" {
+		return Connect(b.url)
+	}
+	// TODO: share the already running qemu-nbd instance instead of spawning
+	// another one per clone.
+	return connectFile(b.file, b.fileFmt, b.fileReadOnly)
+}
+
+// Size return image size.
+func (b *Backend) Size() (uint64, error) {
+	return b.size, nil
+}
+
+// Extents returns the extents overlapping [offset, offset+length), querying
+// the NBD server lazily in maxExtent segments as the iterator is consumed,
+// instead of accumulating the whole range upfront.
+func (b *Backend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	end := min(offset+length, b.size)
+	return &extentsIterator{b: b, pos: offset, end: end, start: offset}, nil
+}
+
+func (b *Backend) blockStatus(offset, length uint64) ([]uint32, error) {
+	var result []uint32
+
+	cb := func(metacontext string, offset uint64, e []uint32, error *int) int {
+		if *error != 0 {
+			panic("expected *error == 0")
+		}
+		if metacontext == "base:allocation" {
+			result = e
+		}
+		return 0
+	}
+
+	// BlockStatus may fail randomly, looks like bug in libnbd.
+	// https://listman.redhat.com/archives/libguestfs/2021-October/msg00113.html
+	for {
+		err := b.h.BlockStatus(length, offset, cb, nil)
+		if err == nil {
+			break
+		}
+		if err.(*libnbd.LibnbdError).Errno != syscall.EINTR {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// ReadAt reads len(p) bytes starting at off from the NBD server.
+func (b *Backend) ReadAt(p []byte, off int64) (int, error) {
+	if err := b.h.Pread(p, uint64(off), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteAt writes len(p) bytes starting at off to the NBD server.
+func (b *Backend) WriteAt(p []byte, off int64) (int, error) {
+	if err := b.h.Pwrite(p, uint64(off), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Zero marks length bytes starting at off as zero, using the NBD
+// WRITE_ZEROES fast path instead of transferring zero bytes.
+func (b *Backend) Zero(off, length uint64) error {
+	return b.h.Zero(length, off, nil)
+}
+
+// Flush writes all buffered data to storage.
+func (b *Backend) Flush() error {
+	return b.h.Flush(nil)
+}
+
+// Close closes the connection the NBD server. The Backend cannot be used after
+// closing the connection.
+func (b *Backend) Close() {
+	b.h.Shutdown(nil)
+	b.h.Close()
+}
+
+func min(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// extentsIterator lazily fetches extents from the NBD server in maxExtent
+// segments, converting NBD (length, flags) pairs to *imageio.Extent as the
+// iterator is consumed. This avoids accumulating the whole requested range
+// in memory upfront.
+type extentsIterator struct {
+	b   *Backend
+	pos uint64 // start of the next segment to fetch from the server.
+	end uint64 // end of the requested range, exclusive.
+
+	// {length, flags, length, flags, ...} for the current segment.
+	// TODO: Keep multiple meta contexts.
+	entries []uint32
+
+	// Index of next pair in entries.
+	next int
+
+	// Start of the next value to return.
+	start uint64
+
+	err error
+}
+
+// Next returns true if there are more values, fetching another segment from
+// the server if the current one is exhausted.
+func (it *extentsIterator) Next() bool {
+	for it.next >= len(it.entries)-1 {
+		if it.pos >= it.end {
+			return false
+		}
+
+		length := min(it.end-it.pos, maxExtent)
+		entries, err := it.b.blockStatus(it.pos, length)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		// The server may return a short or long reply:
+		//
+		// - short reply: one or more extents, ending before the requested
+		//   range. We want to consume what we got, and make more requests
+		//   to the server to get the rest.
+		//
+		// - long reply: all extents, the last extent may end after the
+		//   requested range. We want to consume all the entries to minimize
+		//   the number of calls to the server, and avoid duplicate work on
+		//   the server side.
+		//
+		// In both cases we want to continue where the last entry ended. A
+		// compliant NBD server must not return an extent after the end of
+		// the requested range, but it is easy to clip this.
+
+		var segment []uint32
+		for i := 0; i < len(entries) && it.pos < it.end; i += 2 {
+			segLength := uint32(min(it.end-it.pos, uint64(entries[i])))
+			flags := entries[i+1]
+			it.pos += uint64(segLength)
+			segment = append(segment, segLength, flags)
+		}
+
+		it.entries = segment
+		it.next = 0
+	}
+
+	return true
+}
+
+// Err returns the error, if any, that stopped iteration early.
+func (it *extentsIterator) Err() error {
+	return it.err
+}
+
+// Value return the next extent.
+// Pairs with the same flags are merged only within the current segment.
+// TODO: Merge extents with same flags across segments, or differnt meta
+// context.
+func (it *extentsIterator) Value() *imageio.Extent {
+	// Take the current pair.
+	length := uint64(it.entries[it.next])
+	flags := it.entries[it.next+1]
+	it.next += 2
+
+	// Merge with next pairs with same flags.
+	for it.next < len(it.entries)-1 && flags == it.entries[it.next+1] {
+		length += uint64(it.entries[it.next])
+		it.next += 2
+	}
+
+	zero := (flags & libnbd.STATE_ZERO) == libnbd.STATE_ZERO
+	res := imageio.NewExtent(it.start, length, zero)
+	it.start += length
+
+	return res
+}
+
+// Seek repositions the iterator at offset, discarding any fetched but
+// unread segment so the next Next() call queries the server again.
+func (it *extentsIterator) Seek(offset uint64) error {
+	it.pos = offset
+	it.start = offset
+	it.entries = nil
+	it.next = 0
+	it.err = nil
+	return nil
+}
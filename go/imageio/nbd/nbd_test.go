@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package nbd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"ovirt.org/imageio"
+	"ovirt.org/imageio/units"
+)
+
+func TestNbdSize(t *testing.T) {
+	// TODO: Requires empty 6g image exposed via qemu-nbd
+	b, err := Connect("nbd+unix://?socket=/tmp/nbd.sock")
+	if err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+	defer b.Close()
+
+	imageSize := 6 * units.GiB
+	size, err := b.Size()
+	if err != nil {
+		t.Fatalf("Size() failed: %s", err)
+	} else if size != imageSize {
+		t.Errorf("backend.Size() = %v, expected %v", size, imageSize)
+	}
+}
+
+func TestNbdExtents(t *testing.T) {
+	// TODO: Requires empty 6g image exposed via qemu-nbd
+	b, err := Connect("nbd+unix://?socket=/tmp/nbd.sock")
+	if err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+	defer b.Close()
+
+	imageSize := 6 * units.GiB
+	res, err := b.Extents(0, imageSize)
+	if err != nil {
+		t.Fatalf("Extents() failed: %s", err)
+	}
+
+	var extents []*imageio.Extent
+	for res.Next() {
+		extents = append(extents, res.Value())
+	}
+
+	// Extents with same flags are merged only within a 1 GiB segment, not
+	// across segments.
+	expected := []*imageio.Extent{
+		{Start: 0 * units.GiB, Length: 1 * units.GiB, Zero: true},
+		{Start: 1 * units.GiB, Length: 1 * units.GiB, Zero: true},
+		{Start: 2 * units.GiB, Length: 1 * units.GiB, Zero: true},
+		{Start: 3 * units.GiB, Length: 1 * units.GiB, Zero: true},
+		{Start: 4 * units.GiB, Length: 1 * units.GiB, Zero: true},
+		{Start: 5 * units.GiB, Length: 1 * units.GiB, Zero: true},
+	}
+	if !reflect.DeepEqual(extents, expected) {
+		t.Fatalf("extents:\n%s\nexpected:\n%s\n", dump(extents), dump(expected))
+	}
+}
+
+func dump(v interface{}) []byte {
+	res, _ := json.MarshalIndent(v, "", " ")
+	return res
+}
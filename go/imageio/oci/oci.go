@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+// Package oci implements an imageio.Backend exposing a disk image published
+// as an OCI artifact in a container registry, using the "containerDisk"
+// convention popularized by KubeVirt CDI: a single-layer image whose layer
+// is a tar archive containing one disk image file.
+package oci
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"ovirt.org/imageio"
+	"ovirt.org/imageio/nbd"
+)
+
+// DefaultMediaTypes lists the layer media types recognized as disk image
+// payloads, in the "containerDisk" convention used by KubeVirt CDI.
+var DefaultMediaTypes = []types.MediaType{
+	"application/vnd.kubevirt.containerdisk.v1+gzip",
+	"application/vnd.kubevirt.containerdisk.v1+qcow2",
+	"application/vnd.kubevirt.containerdisk.v1+raw",
+	types.DockerLayer,
+	types.OCILayer,
+}
+
+// qcow2Magic is the first 4 bytes of a qcow2 image.
+const qcow2Magic = "QFI\xfb"
+
+// Backend exposes a disk image published as an OCI artifact. It downloads
+// the matching layer into a local cache file and delegates ReadAt, Size and
+// Extents to an in-process qemu-nbd instance opened read-only on that file.
+// The backend is read-only: WriteAt, Zero and Flush always fail.
+type Backend struct {
+	nbd   *nbd.Backend
+	cache string
+}
+
+// Connect resolves ref (e.g. "docker://registry/example/rhel8-disk:latest"),
+// downloads the first layer whose media type is in DefaultMediaTypes into a
+// local cache file, and returns a connected Backend. Caller should close the
+// backend when done.
+func Connect(ref string) (*Backend, error) {
+	return ConnectMediaTypes(ref, DefaultMediaTypes)
+}
+
+// ConnectMediaTypes is like Connect, but matches layers against the given
+// list of acceptable media types instead of DefaultMediaTypes.
+func ConnectMediaTypes(ref string, mediaTypes []types.MediaType) (*Backend, error) {
+	tag, err := name.ParseReference(trimScheme(ref))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse reference %q: %s", ref, err)
+	}
+
+	img, err := remote.Image(tag, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch image %q: %s", ref, err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read layers of %q: %s", ref, err)
+	}
+
+	layer, err := selectLayer(layers, mediaTypes)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", ref, err)
+	}
+
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read layer of %q: %s", ref, err)
+	}
+	defer rc.Close()
+
+	cache, err := cacheDiskImage(rc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot cache %q: %s", ref, err)
+	}
+
+	format, err := sniffFormat(cache)
+	if err != nil {
+		os.Remove(cache)
+		return nil, err
+	}
+
+	b, err := nbd.ConnectFile(cache, format)
+	if err != nil {
+		os.Remove(cache)
+		return nil, err
+	}
+
+	return &Backend{nbd: b, cache: cache}, nil
+}
+
+// Size return the size of the underlying disk image.
+func (b *Backend) Size() (uint64, error) {
+	return b.nbd.Size()
+}
+
+// Extents returns the extents overlapping [offset, offset+length).
+func (b *Backend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	return b.nbd.Extents(offset, length)
+}
+
+// ReadAt reads len(p) bytes starting at off.
+func (b *Backend) ReadAt(p []byte, off int64) (int, error) {
+	return b.nbd.ReadAt(p, off)
+}
+
+// WriteAt always fails; the oci backend is read-only.
+func (b *Backend) WriteAt(p []byte, off int64) (int, error) {
+	return 0, fmt.Errorf("oci: backend is read-only")
+}
+
+// Zero always fails; the oci backend is read-only.
+func (b *Backend) Zero(off, length uint64) error {
+	return fmt.Errorf("oci: backend is read-only")
+}
+
+// Flush always fails; the oci backend is read-only.
+func (b *Backend) Flush() error {
+	return fmt.Errorf("oci: backend is read-only")
+}
+
+// Close terminates the in-process qemu-nbd instance and removes the cache
+// file. The Backend cannot be used after closing.
+func (b *Backend) Close() {
+	b.nbd.Close()
+	os.Remove(b.cache)
+}
+
+func trimScheme(ref string) string {
+	const scheme = "docker://"
+	if len(ref) > len(scheme) && ref[:len(scheme)] == scheme {
+		return ref[len(scheme):]
+	}
+	return ref
+}
+
+func selectLayer(layers []v1.Layer, mediaTypes []types.MediaType) (v1.Layer, error) {
+	for _, l := range layers {
+		mt, err := l.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		for _, want := range mediaTypes {
+			if mt == want {
+				return l, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no layer matching %v", mediaTypes)
+}
+
+// cacheDiskImage copies the first regular file found in the tar stream r
+// into a temporary file and returns its path. The "containerDisk" convention
+// stores the disk image as the only file in the layer, so the first entry
+// found is the disk image.
+func cacheDiskImage(r io.Reader) (string, error) {
+	f, err := ioutil.TempFile("", "ovirt-img-oci-*.img")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			os.Remove(f.Name())
+			return "", fmt.Errorf("no disk image found in layer")
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		return f.Name(), nil
+	}
+}
+
+// sniffFormat detects the disk image format of the file at path by its
+// magic bytes, defaulting to "raw" when no known format is recognized.
+func sniffFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	if n == len(magic) && string(magic[:]) == qcow2Magic {
+		return "qcow2", nil
+	}
+	return "raw", nil
+}
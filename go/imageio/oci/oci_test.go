@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package oci
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTrimScheme(t *testing.T) {
+	cases := map[string]string{
+		"docker://registry/example/rhel8-disk:latest": "registry/example/rhel8-disk:latest",
+		"registry/example/rhel8-disk:latest":          "registry/example/rhel8-disk:latest",
+	}
+	for in, want := range cases {
+		if got := trimScheme(in); got != want {
+			t.Errorf("trimScheme(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"qcow2", []byte(qcow2Magic + "\x00\x00\x00\x03"), "qcow2"},
+		{"raw", []byte{0, 0, 0, 0, 0, 0, 0, 0}, "raw"},
+		{"empty", nil, "raw"},
+	}
+
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "sniff-*")
+		if err != nil {
+			t.Fatalf("TempFile failed: %s", err)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.Write(c.data); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		f.Close()
+
+		format, err := sniffFormat(f.Name())
+		if err != nil {
+			t.Fatalf("sniffFormat failed: %s", err)
+		}
+		if format != c.format {
+			t.Errorf("%s: sniffFormat() = %q, expected %q", c.name, format, c.format)
+		}
+	}
+}
+
+func TestBackendIsReadOnly(t *testing.T) {
+	b := &Backend{}
+
+	if _, err := b.WriteAt([]byte("x"), 0); err == nil {
+		t.Error("WriteAt succeeded, expected an error")
+	}
+	if err := b.Zero(0, 1); err == nil {
+		t.Error("Zero succeeded, expected an error")
+	}
+	if err := b.Flush(); err == nil {
+		t.Error("Flush succeeded, expected an error")
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package pipe
+
+import "container/list"
+
+// lru is a fixed-size, least-recently-used cache mapping a chunk hash to
+// the location it was last written to during a transfer.
+type lru struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key string
+	loc location
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the location stored for key, marking it as most recently
+// used.
+func (c *lru) get(key string) (location, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return location{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).loc, true
+}
+
+// add stores loc for key, evicting the least recently used entry if the
+// cache is at capacity.
+func (c *lru) add(key string, loc location) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).loc = loc
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&lruEntry{key: key, loc: loc})
+	c.items[key] = el
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
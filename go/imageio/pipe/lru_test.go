@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package pipe
+
+import "testing"
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRU(2)
+
+	c.add("a", location{offset: 0, length: 4096})
+	c.add("b", location{offset: 4096, length: 4096})
+
+	// Touch "a" so "b" becomes the least recently used entry.
+	if _, ok := c.get("a"); !ok {
+		t.Fatalf("expected a to be present")
+	}
+
+	c.add("c", location{offset: 8192, length: 4096})
+
+	if _, ok := c.get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("expected a to still be present")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Errorf("expected c to be present")
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+// Package pipe streams a disk image from one imageio.Backend to another one
+// extent at a time, deduplicating repeated content seen during the same
+// transfer instead of retransferring it. This targets disks with repeated
+// regions, like installer ISOs or cloned VMs.
+package pipe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"ovirt.org/imageio"
+	"ovirt.org/imageio/units"
+)
+
+// DefaultChunkSize is the size of the chunks hashed for dedup, and the
+// largest contiguous range read from src in one ReadAt call.
+const DefaultChunkSize = 4 * units.MiB
+
+// DefaultCacheSize is the number of chunk hashes remembered during a
+// transfer, evicting the least recently used entry once full.
+const DefaultCacheSize = 10000
+
+// DefaultHash is the hash algorithm used to identify chunks when Options.Hash
+// is empty.
+const DefaultHash = "sha256"
+
+// Options control Copy.
+type Options struct {
+	// ChunkSize is the size of the chunks hashed for dedup. Zero means
+	// DefaultChunkSize.
+	ChunkSize uint64
+
+	// CacheSize is the number of chunk hashes to remember during the
+	// transfer. Zero means DefaultCacheSize.
+	CacheSize int
+
+	// Hash names the hash algorithm used to identify chunks. Empty means
+	// DefaultHash. Currently only "sha256" is supported.
+	Hash string
+}
+
+// serverCopier is implemented by destinations that can duplicate bytes they
+// already have at a new offset without retransferring them.
+type serverCopier interface {
+	SupportsCopy() bool
+	CopyAt(dstOffset, length, srcOffset uint64) error
+}
+
+// Copy streams src to dst one extent at a time. Zero extents are punched
+// using Zero instead of transferring zero bytes. Non-zero extents are split
+// into opts.ChunkSize chunks; each chunk is read from src, then hashed and
+// looked up in an in-memory cache of chunks already written during this
+// transfer. On a cache hit, if dst supports server-side copy, the chunk is
+// duplicated there instead of being sent to dst again; otherwise the chunk
+// is always written.
+func Copy(src, dst imageio.Backend, opts Options) error {
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	newHash, err := hasher(opts.Hash)
+	if err != nil {
+		return err
+	}
+
+	cacheSize := opts.CacheSize
+	if cacheSize == 0 {
+		cacheSize = DefaultCacheSize
+	}
+
+	copier, canCopy := dst.(serverCopier)
+	canCopy = canCopy && copier.SupportsCopy()
+
+	size, err := src.Size()
+	if err != nil {
+		return err
+	}
+
+	res, err := src.Extents(0, size)
+	if err != nil {
+		return err
+	}
+
+	cache := newLRU(cacheSize)
+	buf := make([]byte, chunkSize)
+
+	for res.Next() {
+		e := res.Value()
+		if e.Zero {
+			if err := dst.Zero(e.Start, e.Length); err != nil {
+				return err
+			}
+			continue
+		}
+
+		start, length := e.Start, e.Length
+		for length > 0 {
+			n := chunkSize
+			if n > length {
+				n = length
+			}
+
+			chunk := buf[:n]
+			if _, err := src.ReadAt(chunk, int64(start)); err != nil {
+				return err
+			}
+
+			key := hashChunk(newHash(), chunk)
+
+			if loc, ok := cache.get(key); ok && canCopy && loc.length == n {
+				if err := copier.CopyAt(start, n, loc.offset); err != nil {
+					return err
+				}
+			} else if _, err := dst.WriteAt(chunk, int64(start)); err != nil {
+				return err
+			}
+
+			cache.add(key, location{offset: start, length: n})
+
+			start += n
+			length -= n
+		}
+	}
+	if ec, ok := res.(interface{ Err() error }); ok {
+		if err := ec.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// location records where a chunk was last written during this transfer.
+type location struct {
+	offset uint64
+	length uint64
+}
+
+func hasher(name string) (func() hash.Hash, error) {
+	if name == "" {
+		name = DefaultHash
+	}
+	switch name {
+	case "sha256":
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("pipe: unsupported hash algorithm: %s", name)
+	}
+}
+
+func hashChunk(h hash.Hash, p []byte) string {
+	h.Write(p)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package pipe
+
+import (
+	"bytes"
+	"testing"
+
+	"ovirt.org/imageio"
+)
+
+// memBackend is a minimal in-memory imageio.Backend used to test Copy
+// without a real NBD or imageio server.
+type memBackend struct {
+	data         []byte
+	extents      []*imageio.Extent
+	supportsCopy bool
+	writes       int
+	copies       int
+}
+
+func (b *memBackend) Size() (uint64, error) { return uint64(len(b.data)), nil }
+
+func (b *memBackend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	return imageio.NewExtentsWrapperRange(b.extents, offset, length), nil
+}
+
+func (b *memBackend) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, b.data[off:]), nil
+}
+
+func (b *memBackend) WriteAt(p []byte, off int64) (int, error) {
+	b.writes++
+	return copy(b.data[off:], p), nil
+}
+
+func (b *memBackend) Zero(off, length uint64) error {
+	for i := uint64(0); i < length; i++ {
+		b.data[off+i] = 0
+	}
+	return nil
+}
+
+func (b *memBackend) Flush() error { return nil }
+func (b *memBackend) Close()       {}
+
+func (b *memBackend) SupportsCopy() bool { return b.supportsCopy }
+
+func (b *memBackend) CopyAt(dstOffset, length, srcOffset uint64) error {
+	b.copies++
+	copy(b.data[dstOffset:dstOffset+length], b.data[srcOffset:srcOffset+length])
+	return nil
+}
+
+func TestCopyDedupsRepeatedChunksWhenDstSupportsCopy(t *testing.T) {
+	chunk := bytes.Repeat([]byte("a"), int(DefaultChunkSize))
+	data := append(append([]byte{}, chunk...), chunk...)
+
+	src := &memBackend{
+		data:    data,
+		extents: []*imageio.Extent{imageio.NewExtent(0, uint64(len(data)), false)},
+	}
+	dst := &memBackend{data: make([]byte, len(data)), supportsCopy: true}
+
+	if err := Copy(src, dst, Options{}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+
+	if !bytes.Equal(dst.data, src.data) {
+		t.Fatalf("dst data does not match src data")
+	}
+	if dst.writes != 1 {
+		t.Errorf("writes = %d, expected 1", dst.writes)
+	}
+	if dst.copies != 1 {
+		t.Errorf("copies = %d, expected 1", dst.copies)
+	}
+}
+
+func TestCopyResendsRepeatedChunksWhenDstLacksCopy(t *testing.T) {
+	chunk := bytes.Repeat([]byte("a"), int(DefaultChunkSize))
+	data := append(append([]byte{}, chunk...), chunk...)
+
+	src := &memBackend{
+		data:    data,
+		extents: []*imageio.Extent{imageio.NewExtent(0, uint64(len(data)), false)},
+	}
+	dst := &memBackend{data: make([]byte, len(data))}
+
+	if err := Copy(src, dst, Options{}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+
+	if !bytes.Equal(dst.data, src.data) {
+		t.Fatalf("dst data does not match src data")
+	}
+	if dst.writes != 2 {
+		t.Errorf("writes = %d, expected 2", dst.writes)
+	}
+	if dst.copies != 0 {
+		t.Errorf("copies = %d, expected 0", dst.copies)
+	}
+}
+
+func TestCopyZeroExtent(t *testing.T) {
+	src := &memBackend{
+		data:    bytes.Repeat([]byte{0}, 4096),
+		extents: []*imageio.Extent{imageio.NewExtent(0, 4096, true)},
+	}
+	dst := &memBackend{data: bytes.Repeat([]byte("x"), 4096)}
+
+	if err := Copy(src, dst, Options{}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+
+	if !bytes.Equal(dst.data, make([]byte, 4096)) {
+		t.Fatalf("expected dst to be zeroed")
+	}
+	if dst.writes != 0 {
+		t.Errorf("writes = %d, expected 0", dst.writes)
+	}
+}
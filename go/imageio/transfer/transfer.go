@@ -0,0 +1,372 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+// Package transfer copies a disk image between two imageio.Backend values,
+// splitting the image into one contiguous byte range per worker and
+// running each worker on its own connection, requesting extents for just
+// its own range.
+package transfer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"ovirt.org/imageio"
+)
+
+// DefaultRequestSize is the largest contiguous byte range copied in a
+// single ReadAt/WriteAt round trip, and the threshold up to which adjacent
+// small extents are coalesced.
+const DefaultRequestSize = 4 * 1024 * 1024
+
+// Cloner is implemented by backends that can open another, independent
+// connection to the same disk image, so a worker can own a private
+// connection instead of sharing one across goroutines.
+type Cloner interface {
+	Clone() (imageio.Backend, error)
+}
+
+// ConcurrencyLimiter is implemented by backends that can report a server
+// side concurrency limit, for example from imageio's OPTIONS response. Copy
+// uses it to size its worker pool automatically when opts.Workers is 0.
+type ConcurrencyLimiter interface {
+	MaxReaders() int
+	MaxWriters() int
+}
+
+// Progress reports the number of bytes transferred so far.
+type Progress struct {
+	Transferred uint64
+}
+
+// Options control Copy.
+type Options struct {
+	// Workers is the number of concurrent connections used to transfer the
+	// image. Zero auto-sizes the pool from src's and dst's ConcurrencyLimiter,
+	// when implemented, falling back to 1.
+	Workers int
+
+	// RequestSize is the largest contiguous byte range copied in a single
+	// ReadAt/WriteAt round trip; adjacent small extents are coalesced up to
+	// this size. Zero means DefaultRequestSize.
+	RequestSize uint64
+
+	// Progress, if not nil, receives an update after every copied range.
+	// Copy closes it before returning.
+	Progress chan<- Progress
+
+	// RateLimit caps the aggregate transfer rate in bytes per second, shared
+	// across all workers. Zero means unlimited.
+	RateLimit uint64
+}
+
+// chunk is a contiguous byte range to copy, planned from src's extents.
+type chunk struct {
+	start  uint64
+	length uint64
+	zero   bool
+}
+
+// Copy transfers every non-zero extent of src to dst and punches holes for
+// zero extents, using up to opts.Workers concurrent connections. The image
+// is split into one contiguous byte range per worker, and each worker calls
+// src.Extents for only its own range. When more than one worker is used
+// (opts.Workers greater than 1, or auto-sized to more than 1), both src and
+// dst must implement Cloner.
+func Copy(src, dst imageio.Backend, opts Options) error {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = autoWorkers(src, dst)
+	}
+
+	requestSize := opts.RequestSize
+	if requestSize == 0 {
+		requestSize = DefaultRequestSize
+	}
+
+	var limiter *rateLimiter
+	if opts.RateLimit > 0 {
+		limiter = newRateLimiter(opts.RateLimit)
+	}
+
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+
+	size, err := src.Size()
+	if err != nil {
+		return err
+	}
+	ranges := splitRange(size, workers)
+
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		firstErr    error
+		transferred uint64
+	)
+
+	report := func(n uint64) {
+		if opts.Progress == nil {
+			return
+		}
+		mu.Lock()
+		transferred += n
+		p := Progress{Transferred: transferred}
+		mu.Unlock()
+		opts.Progress <- p
+	}
+
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	// Open every worker's backends up front, so a clone failure on a later
+	// worker doesn't leave an earlier worker running unsupervised. Workers
+	// whose range came up empty (more workers than bytes to split) are
+	// skipped entirely: Extents(offset, 0) is not always empty (backends
+	// built on imageio.NewExtentsWrapperRange treat it as "to the end of the
+	// image"), so an unused worker must never call it.
+	var workerBackendList []workerPair
+	var workerRanges []byteRange
+	for i := 0; i < workers; i++ {
+		if ranges[i].length == 0 {
+			continue
+		}
+		workerSrc, workerDst, closeWorker, err := workerBackends(src, dst, i)
+		if err != nil {
+			for _, p := range workerBackendList {
+				p.close()
+			}
+			return err
+		}
+		workerBackendList = append(workerBackendList, workerPair{workerSrc, workerDst, closeWorker})
+		workerRanges = append(workerRanges, ranges[i])
+	}
+
+	for i, p := range workerBackendList {
+		r := workerRanges[i]
+		wg.Add(1)
+		go func(s, d imageio.Backend, closeWorker func(), r byteRange) {
+			defer wg.Done()
+			defer closeWorker()
+
+			chunks, err := planRange(s, r.start, r.length, requestSize)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			buf := make([]byte, requestSize)
+			for _, c := range chunks {
+				if limiter != nil {
+					limiter.wait(c.length)
+				}
+				if err := copyChunk(s, d, buf, c); err != nil {
+					fail(err)
+					return
+				}
+				report(c.length)
+			}
+		}(p.src, p.dst, p.close, r)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// byteRange is a contiguous, half-open range of bytes in the image,
+// assigned to a single worker.
+type byteRange struct {
+	start, length uint64
+}
+
+// splitRange divides [0, size) into up to n contiguous, roughly equal
+// ranges, so each worker can request extents for just its own slice
+// instead of sharing a single plan computed up front. The last range
+// absorbs any remainder from the division.
+func splitRange(size uint64, n int) []byteRange {
+	base := size / uint64(n)
+	ranges := make([]byteRange, n)
+	start := uint64(0)
+	for i := 0; i < n; i++ {
+		length := base
+		if i == n-1 {
+			length = size - start
+		}
+		ranges[i] = byteRange{start: start, length: length}
+		start += length
+	}
+	return ranges
+}
+
+// autoWorkers sizes the worker pool from src's read concurrency limit and
+// dst's write concurrency limit, falling back to 1 when either side doesn't
+// implement ConcurrencyLimiter or doesn't advertise a limit.
+func autoWorkers(src, dst imageio.Backend) int {
+	srcLimiter, ok := src.(ConcurrencyLimiter)
+	if !ok {
+		return 1
+	}
+	dstLimiter, ok := dst.(ConcurrencyLimiter)
+	if !ok {
+		return 1
+	}
+
+	readers, writers := srcLimiter.MaxReaders(), dstLimiter.MaxWriters()
+	if readers <= 0 || writers <= 0 {
+		return 1
+	}
+
+	if readers < writers {
+		return readers
+	}
+	return writers
+}
+
+// workerPair holds the source and destination backend a single worker uses,
+// and the func to close whichever of them it opened itself.
+type workerPair struct {
+	src, dst imageio.Backend
+	close    func()
+}
+
+// workerBackends returns the source and destination backend a worker should
+// use: the original backend for worker 0, and a clone for every other
+// worker. closeWorker closes only the connections this call opened.
+func workerBackends(src, dst imageio.Backend, worker int) (imageio.Backend, imageio.Backend, func(), error) {
+	if worker == 0 {
+		return src, dst, func() {}, nil
+	}
+
+	srcCloner, ok := src.(Cloner)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("transfer: source backend does not support Clone()")
+	}
+	dstCloner, ok := dst.(Cloner)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("transfer: destination backend does not support Clone()")
+	}
+
+	workerSrc, err := srcCloner.Clone()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	workerDst, err := dstCloner.Clone()
+	if err != nil {
+		workerSrc.Close()
+		return nil, nil, nil, err
+	}
+
+	return workerSrc, workerDst, func() {
+		workerSrc.Close()
+		workerDst.Close()
+	}, nil
+}
+
+// rateLimiter throttles aggregate throughput to a fixed bytes per second
+// rate, shared by every worker calling wait.
+type rateLimiter struct {
+	bytesPerSec uint64
+
+	mu    sync.Mutex
+	start time.Time
+	sent  uint64
+}
+
+func newRateLimiter(bytesPerSec uint64) *rateLimiter {
+	return &rateLimiter{bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+// wait blocks until sending n more bytes would not exceed bytesPerSec,
+// averaged since the limiter was created.
+func (l *rateLimiter) wait(n uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sent += n
+	allowed := time.Since(l.start).Seconds() * float64(l.bytesPerSec)
+	if delta := float64(l.sent) - allowed; delta > 0 {
+		time.Sleep(time.Duration(delta / float64(l.bytesPerSec) * float64(time.Second)))
+	}
+}
+
+func copyChunk(src, dst imageio.Backend, buf []byte, c chunk) error {
+	if c.zero {
+		return dst.Zero(c.start, c.length)
+	}
+
+	start, length := c.start, c.length
+	for length > 0 {
+		n := uint64(len(buf))
+		if n > length {
+			n = length
+		}
+
+		if _, err := src.ReadAt(buf[:n], int64(start)); err != nil {
+			return err
+		}
+		if _, err := dst.WriteAt(buf[:n], int64(start)); err != nil {
+			return err
+		}
+
+		start += n
+		length -= n
+	}
+	return nil
+}
+
+// plan reads all of src's extents and splits them into chunks no larger
+// than requestSize, coalescing adjacent extents with the same zero flag
+// first so runs of small extents are copied in as few round trips as
+// possible.
+func plan(src imageio.Backend, requestSize uint64) ([]chunk, error) {
+	size, err := src.Size()
+	if err != nil {
+		return nil, err
+	}
+	return planRange(src, 0, size, requestSize)
+}
+
+// planRange is like plan, but reads only the extents overlapping
+// [offset, offset+length) via src.Extents, so a worker can plan just its
+// own slice of the image instead of the whole thing.
+func planRange(src imageio.Backend, offset, length, requestSize uint64) ([]chunk, error) {
+	res, err := src.Extents(offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []chunk
+	for res.Next() {
+		e := res.Value()
+		if n := len(merged); n > 0 && merged[n-1].zero == e.Zero &&
+			merged[n-1].start+merged[n-1].length == e.Start {
+			merged[n-1].length += e.Length
+			continue
+		}
+		merged = append(merged, chunk{start: e.Start, length: e.Length, zero: e.Zero})
+	}
+	if ec, ok := res.(interface{ Err() error }); ok {
+		if err := ec.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var chunks []chunk
+	for _, c := range merged {
+		for c.length > requestSize {
+			chunks = append(chunks, chunk{start: c.start, length: requestSize, zero: c.zero})
+			c.start += requestSize
+			c.length -= requestSize
+		}
+		chunks = append(chunks, c)
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,229 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: LGPL-2.1-or-later
+
+package transfer
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"ovirt.org/imageio"
+)
+
+type fakeBackend struct {
+	imageio.Backend
+	extents    []*imageio.Extent
+	size       uint64
+	maxReaders int
+	maxWriters int
+}
+
+func (b *fakeBackend) Size() (uint64, error) { return b.size, nil }
+
+func (b *fakeBackend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	return imageio.NewExtentsWrapperRange(b.extents, offset, length), nil
+}
+
+func (b *fakeBackend) MaxReaders() int { return b.maxReaders }
+func (b *fakeBackend) MaxWriters() int { return b.maxWriters }
+
+func TestPlanCoalescesAndSplits(t *testing.T) {
+	src := &fakeBackend{size: 12298, extents: []*imageio.Extent{
+		imageio.NewExtent(0, 4096, false),
+		imageio.NewExtent(4096, 4096, false),
+		imageio.NewExtent(8192, 4096, true),
+		imageio.NewExtent(12288, 10, false),
+	}}
+
+	chunks, err := plan(src, 4096)
+	if err != nil {
+		t.Fatalf("plan failed: %s", err)
+	}
+
+	expected := []chunk{
+		{start: 0, length: 4096, zero: false},
+		{start: 4096, length: 4096, zero: false},
+		{start: 8192, length: 4096, zero: true},
+		{start: 12288, length: 10, zero: false},
+	}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Fatalf("plan() = %+v, expected %+v", chunks, expected)
+	}
+}
+
+// memBackend is a minimal in-memory imageio.Backend used to test Copy end
+// to end without a real NBD or imageio server. Clone returns the same
+// backend, mimicking workers sharing a connection to the same export.
+type memBackend struct {
+	data    []byte
+	extents []*imageio.Extent
+
+	mu           sync.Mutex
+	writes       int
+	extentsCalls []byteRange
+}
+
+func (b *memBackend) Size() (uint64, error) { return uint64(len(b.data)), nil }
+
+func (b *memBackend) Extents(offset, length uint64) (imageio.ExtentsResult, error) {
+	b.mu.Lock()
+	b.extentsCalls = append(b.extentsCalls, byteRange{start: offset, length: length})
+	b.mu.Unlock()
+	return imageio.NewExtentsWrapperRange(b.extents, offset, length), nil
+}
+
+func (b *memBackend) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, b.data[off:]), nil
+}
+
+func (b *memBackend) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes++
+	return copy(b.data[off:], p), nil
+}
+
+func (b *memBackend) Zero(off, length uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := uint64(0); i < length; i++ {
+		b.data[off+i] = 0
+	}
+	return nil
+}
+
+func (b *memBackend) Flush() error { return nil }
+func (b *memBackend) Close()       {}
+
+func (b *memBackend) Clone() (imageio.Backend, error) { return b, nil }
+
+func TestCopyTransfersDataAndZeroExtents(t *testing.T) {
+	data := append(bytes.Repeat([]byte("a"), 4096), bytes.Repeat([]byte("b"), 4096)...)
+	src := &memBackend{
+		data: data,
+		extents: []*imageio.Extent{
+			imageio.NewExtent(0, 4096, false),
+			imageio.NewExtent(4096, 4096, true),
+		},
+	}
+	dst := &memBackend{data: bytes.Repeat([]byte("x"), 8192)}
+
+	progress := make(chan Progress)
+	var reports []Progress
+	done := make(chan struct{})
+	go func() {
+		for p := range progress {
+			reports = append(reports, p)
+		}
+		close(done)
+	}()
+
+	if err := Copy(src, dst, Options{Progress: progress}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+	<-done
+
+	want := append(bytes.Repeat([]byte("a"), 4096), bytes.Repeat([]byte{0}, 4096)...)
+	if !bytes.Equal(dst.data, want) {
+		t.Fatalf("dst data = %q, expected %q", dst.data, want)
+	}
+	if len(reports) == 0 || reports[len(reports)-1].Transferred != 8192 {
+		t.Errorf("final progress = %+v, expected Transferred=8192", reports)
+	}
+}
+
+func TestCopyMultipleWorkersRequiresCloner(t *testing.T) {
+	src := &fakeBackend{size: 8192, extents: []*imageio.Extent{
+		imageio.NewExtent(0, 8192, false),
+	}}
+	dst := &fakeBackend{}
+
+	if err := Copy(src, dst, Options{Workers: 2}); err == nil {
+		t.Fatal("Copy succeeded, expected an error")
+	}
+}
+
+func TestCopyMultipleWorkers(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 16384)
+	src := &memBackend{
+		data:    data,
+		extents: []*imageio.Extent{imageio.NewExtent(0, uint64(len(data)), false)},
+	}
+	dst := &memBackend{data: make([]byte, len(data))}
+
+	if err := Copy(src, dst, Options{Workers: 4, RequestSize: 4096}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+
+	if !bytes.Equal(dst.data, src.data) {
+		t.Fatalf("dst data does not match src data")
+	}
+}
+
+func TestCopyRequestsExtentsPerWorkerRange(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 16384)
+	src := &memBackend{
+		data:    data,
+		extents: []*imageio.Extent{imageio.NewExtent(0, uint64(len(data)), false)},
+	}
+	dst := &memBackend{data: make([]byte, len(data))}
+
+	if err := Copy(src, dst, Options{Workers: 4, RequestSize: 4096}); err != nil {
+		t.Fatalf("Copy failed: %s", err)
+	}
+
+	if len(src.extentsCalls) != 4 {
+		t.Fatalf("Extents() called %d times, expected 4", len(src.extentsCalls))
+	}
+
+	sort.Slice(src.extentsCalls, func(i, j int) bool {
+		return src.extentsCalls[i].start < src.extentsCalls[j].start
+	})
+	want := []byteRange{
+		{start: 0, length: 4096},
+		{start: 4096, length: 4096},
+		{start: 8192, length: 4096},
+		{start: 12288, length: 4096},
+	}
+	if !reflect.DeepEqual(src.extentsCalls, want) {
+		t.Fatalf("Extents() calls = %+v, expected %+v", src.extentsCalls, want)
+	}
+}
+
+func TestAutoWorkers(t *testing.T) {
+	src := &fakeBackend{maxReaders: 8, maxWriters: 8}
+	dst := &fakeBackend{maxReaders: 8, maxWriters: 4}
+
+	if n := autoWorkers(src, dst); n != 4 {
+		t.Errorf("autoWorkers() = %v, expected 4", n)
+	}
+}
+
+func TestAutoWorkersFallback(t *testing.T) {
+	if n := autoWorkers(&fakeBackend{}, &fakeBackend{maxWriters: 4}); n != 1 {
+		t.Errorf("autoWorkers() = %v, expected 1", n)
+	}
+}
+
+func TestPlanSplitsLargeExtent(t *testing.T) {
+	src := &fakeBackend{size: 10000, extents: []*imageio.Extent{
+		imageio.NewExtent(0, 10000, false),
+	}}
+
+	chunks, err := plan(src, 4096)
+	if err != nil {
+		t.Fatalf("plan failed: %s", err)
+	}
+
+	expected := []chunk{
+		{start: 0, length: 4096, zero: false},
+		{start: 4096, length: 4096, zero: false},
+		{start: 8192, length: 1808, zero: false},
+	}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Fatalf("plan() = %+v, expected %+v", chunks, expected)
+	}
+}
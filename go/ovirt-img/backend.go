@@ -12,7 +12,8 @@ import (
 
 	"ovirt.org/imageio"
 	"ovirt.org/imageio/http"
-	"ovirt.org/ovirt-img/nbd"
+	"ovirt.org/imageio/nbd"
+	"ovirt.org/imageio/oci"
 	"ovirt.org/ovirt-img/qemuimg"
 )
 
@@ -44,6 +45,35 @@ func connectFile(s string) (imageio.Backend, error) {
 	return nbd.ConnectFile(s, info.Format)
 }
 
+// createFile creates a new raw image file of size bytes at s, overwriting
+// it if it already exists, and returns a writable Backend connected to it.
+func createFile(s string, size uint64) (imageio.Backend, error) {
+	if err := qemuimg.Create(s, "raw", size); err != nil {
+		return nil, err
+	}
+	return nbd.ConnectFileWritable(s, "raw")
+}
+
+// connectDst resolves dst, the destination of a copy, for writing. A local
+// path (no scheme, or an explicit file:// URL) is created as a new raw
+// image of size bytes, overwriting it if it already exists, matching
+// downloadFile; any other URL is connected normally via connectURL.
+func connectDst(s string, size uint64) (imageio.Backend, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "":
+		return createFile(s, size)
+	case "file":
+		return createFile(u.Path, size)
+	default:
+		return connectURL(s)
+	}
+}
+
 func connectURL(s string) (imageio.Backend, error) {
 	u, err := url.Parse(s)
 	if err != nil {
@@ -53,9 +83,16 @@ func connectURL(s string) (imageio.Backend, error) {
 	case "nbd", "nbd+unix":
 		return nbd.Connect(s)
 	case "https":
-		return http.Connect(s)
+		return http.ConnectWithOptions(s, http.Options{
+			CAFile:     cafile,
+			ClientCert: clientCert,
+			ClientKey:  clientKey,
+			SPKIPin:    spkiPin,
+		})
 	case "file":
 		return connectFile(u.Path)
+	case "docker":
+		return oci.Connect(s)
 	default:
 		return nil, fmt.Errorf("Unsupported URL: %s", s)
 	}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"ovirt.org/imageio/transfer"
+)
+
+// copyURL copies src to dst using up to workers concurrent connections,
+// reporting progress to stderr.
+func copyURL(src, dst string, workers int) {
+	srcBackend, err := connect(src)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer srcBackend.Close()
+
+	size, err := srcBackend.Size()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	dstBackend, err := connectDst(dst, size)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer dstBackend.Close()
+
+	progress := make(chan transfer.Progress)
+	done := make(chan struct{})
+	go func() {
+		for p := range progress {
+			fmt.Fprintf(os.Stderr, "\r%d bytes transferred", p.Transferred)
+		}
+		close(done)
+	}()
+
+	err = transfer.Copy(srcBackend, dstBackend, transfer.Options{
+		Workers:  workers,
+		Progress: progress,
+	})
+	<-done
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	if err := dstBackend.Flush(); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
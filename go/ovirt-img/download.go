@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"log"
+)
+
+// downloadFile downloads src, an imageio URL, to dst, creating a new raw
+// local disk image of the right size, using up to transferWorkers
+// concurrent connections.
+func downloadFile(src, dst string) {
+	srcBackend, err := connectURL(src)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer srcBackend.Close()
+
+	size, err := srcBackend.Size()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	dstBackend, err := createFile(dst, size)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer dstBackend.Close()
+
+	if err := runTransfer(srcBackend, dstBackend, size); err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	if err := dstBackend.Flush(); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package runtimetune
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot and procSelfCgroup are vars, not consts, so tests can point
+// them at fixture files instead of the real cgroup filesystem.
+var (
+	cgroupRoot     = "/sys/fs/cgroup"
+	procSelfCgroup = "/proc/self/cgroup"
+)
+
+func tune(o overrides) {
+	if !o.gomaxprocs {
+		if quota, period, ok := cpuQuota(); ok && period > 0 {
+			procs := int(math.Ceil(quota / period))
+			if procs < 1 {
+				procs = 1
+			}
+			runtime.GOMAXPROCS(procs)
+		}
+	}
+
+	if !o.gomemlimit && !o.memlimitOff {
+		if limit, ok := memoryLimit(); ok {
+			debug.SetMemoryLimit(int64(float64(limit) * o.memoryFactor))
+		}
+	}
+}
+
+// cpuQuota returns the cgroup CPU quota and period in microseconds, and
+// whether a bounded quota was found.
+func cpuQuota() (quota, period float64, ok bool) {
+	if isCgroupV2() {
+		data, err := os.ReadFile(cgroupV2Path("cpu.max"))
+		if err != nil {
+			return 0, 0, false
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, 0, false
+		}
+		q, err1 := strconv.ParseFloat(fields[0], 64)
+		p, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil || p <= 0 {
+			return 0, 0, false
+		}
+		return q, p, true
+	}
+
+	quotaUs, err := readInt64(cgroupV1Path("cpu", "cpu.cfs_quota_us"))
+	if err != nil || quotaUs <= 0 {
+		return 0, 0, false
+	}
+	periodUs, err := readInt64(cgroupV1Path("cpu", "cpu.cfs_period_us"))
+	if err != nil || periodUs <= 0 {
+		return 0, 0, false
+	}
+	return float64(quotaUs), float64(periodUs), true
+}
+
+// memoryLimit returns the cgroup memory limit in bytes, and whether a
+// bounded limit was found.
+func memoryLimit() (uint64, bool) {
+	if isCgroupV2() {
+		data, err := os.ReadFile(cgroupV2Path("memory.max"))
+		if err != nil {
+			return 0, false
+		}
+		s := strings.TrimSpace(string(data))
+		if s == "max" {
+			return 0, false
+		}
+		limit, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return limit, true
+	}
+
+	limit, err := readUint64(cgroupV1Path("memory", "memory.limit_in_bytes"))
+	if err != nil {
+		return 0, false
+	}
+	// cgroup v1 reports a very large number (close to the max int64, rounded
+	// down to a page boundary) when no limit is set.
+	if limit > math.MaxInt64-(1<<20) {
+		return 0, false
+	}
+	return limit, true
+}
+
+func isCgroupV2() bool {
+	_, err := os.Stat(cgroupRoot + "/cgroup.controllers")
+	return err == nil
+}
+
+// cgroupV2Path returns the path to file in this process's cgroup v2
+// hierarchy.
+func cgroupV2Path(file string) string {
+	return cgroupRoot + "/" + cgroupPath("") + "/" + file
+}
+
+// cgroupV1Path returns the path to file under controller in this process's
+// cgroup v1 hierarchy.
+func cgroupV1Path(controller, file string) string {
+	return cgroupRoot + "/" + controller + "/" + cgroupPath(controller) + "/" + file
+}
+
+// cgroupPath returns this process's cgroup path for controller, read from
+// /proc/self/cgroup. For cgroup v2, controller is empty and the unified
+// hierarchy entry (prefixed "0::") is used.
+func cgroupPath(controller string) string {
+	f, err := os.Open(procSelfCgroup)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" && fields[0] == "0" && fields[1] == "" {
+			return strings.TrimPrefix(fields[2], "/")
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == controller {
+				return strings.TrimPrefix(fields[2], "/")
+			}
+		}
+	}
+
+	return ""
+}
+
+func readInt64(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func readUint64(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
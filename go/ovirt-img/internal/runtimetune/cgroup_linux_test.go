@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package runtimetune
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withCgroupFixture points cgroupRoot and procSelfCgroup at a fresh fixture
+// directory for the duration of the test, restoring the originals after.
+func withCgroupFixture(t *testing.T, cgroupFile string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroupFile), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	origRoot, origProc := cgroupRoot, procSelfCgroup
+	cgroupRoot = dir
+	procSelfCgroup = filepath.Join(dir, "cgroup")
+	t.Cleanup(func() {
+		cgroupRoot, procSelfCgroup = origRoot, origProc
+	})
+
+	return dir
+}
+
+func TestCpuQuotaV2(t *testing.T) {
+	dir := withCgroupFixture(t, "0::/\n")
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte("200000 100000\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	quota, period, ok := cpuQuota()
+	if !ok {
+		t.Fatal("cpuQuota() = false, expected true")
+	}
+	if quota != 200000 || period != 100000 {
+		t.Errorf("cpuQuota() = (%v, %v), expected (200000, 100000)", quota, period)
+	}
+}
+
+func TestCpuQuotaV2Unlimited(t *testing.T) {
+	dir := withCgroupFixture(t, "0::/\n")
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte("max 100000\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	if _, _, ok := cpuQuota(); ok {
+		t.Error("cpuQuota() = true, expected false for an unlimited quota")
+	}
+}
+
+func TestCpuQuotaV1(t *testing.T) {
+	dir := withCgroupFixture(t, "4:cpu,cpuacct:/mycgroup\n")
+	cpuDir := filepath.Join(dir, "cpu", "mycgroup")
+	if err := os.MkdirAll(cpuDir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(cpuDir, "cpu.cfs_quota_us"), []byte("150000\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(cpuDir, "cpu.cfs_period_us"), []byte("100000\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	quota, period, ok := cpuQuota()
+	if !ok {
+		t.Fatal("cpuQuota() = false, expected true")
+	}
+	if quota != 150000 || period != 100000 {
+		t.Errorf("cpuQuota() = (%v, %v), expected (150000, 100000)", quota, period)
+	}
+}
+
+func TestCpuQuotaV1Unbounded(t *testing.T) {
+	dir := withCgroupFixture(t, "4:cpu,cpuacct:/mycgroup\n")
+	cpuDir := filepath.Join(dir, "cpu", "mycgroup")
+	if err := os.MkdirAll(cpuDir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(cpuDir, "cpu.cfs_quota_us"), []byte("-1\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	if _, _, ok := cpuQuota(); ok {
+		t.Error("cpuQuota() = true, expected false for an unbounded quota (-1)")
+	}
+}
+
+func TestMemoryLimitV2(t *testing.T) {
+	dir := withCgroupFixture(t, "0::/\n")
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte("1073741824\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	limit, ok := memoryLimit()
+	if !ok {
+		t.Fatal("memoryLimit() = false, expected true")
+	}
+	if limit != 1073741824 {
+		t.Errorf("memoryLimit() = %v, expected 1073741824", limit)
+	}
+}
+
+func TestMemoryLimitV2Unlimited(t *testing.T) {
+	dir := withCgroupFixture(t, "0::/\n")
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte("max\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	if _, ok := memoryLimit(); ok {
+		t.Error("memoryLimit() = true, expected false for an unlimited max")
+	}
+}
+
+func TestMemoryLimitV1Unlimited(t *testing.T) {
+	dir := withCgroupFixture(t, "4:memory:/mycgroup\n")
+	memDir := filepath.Join(dir, "memory", "mycgroup")
+	if err := os.MkdirAll(memDir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %s", err)
+	}
+	// cgroup v1's sentinel for "no limit": close to MaxInt64, rounded to a
+	// page boundary.
+	if err := os.WriteFile(filepath.Join(memDir, "memory.limit_in_bytes"), []byte("9223372036854771712\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	if _, ok := memoryLimit(); ok {
+		t.Error("memoryLimit() = true, expected false for the v1 unlimited sentinel")
+	}
+}
+
+func TestMemoryLimitV1Bounded(t *testing.T) {
+	dir := withCgroupFixture(t, "4:memory:/mycgroup\n")
+	memDir := filepath.Join(dir, "memory", "mycgroup")
+	if err := os.MkdirAll(memDir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(memDir, "memory.limit_in_bytes"), []byte("536870912\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %s", err)
+	}
+
+	limit, ok := memoryLimit()
+	if !ok {
+		t.Fatal("memoryLimit() = false, expected true")
+	}
+	if limit != 536870912 {
+		t.Errorf("memoryLimit() = %v, expected 536870912", limit)
+	}
+}
@@ -0,0 +1,9 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+//go:build !linux
+
+package runtimetune
+
+// tune is a no-op outside Linux; cgroups are a Linux-specific mechanism.
+func tune(o overrides) {}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package runtimetune adjusts GOMAXPROCS and the Go runtime's soft memory
+// limit to match the cgroup the process actually runs in, instead of the
+// host. This matters when ovirt-img runs in a container (CDI importer pods,
+// oVirt hosts with systemd slices) with a CPU and memory allocation much
+// smaller than the host's.
+package runtimetune
+
+import (
+	"os"
+	"strconv"
+)
+
+// defaultMemoryFactor is the fraction of the cgroup memory limit passed to
+// debug.SetMemoryLimit, leaving headroom for memory the Go runtime does not
+// account for (e.g. cgo allocations, thread stacks).
+const defaultMemoryFactor = 0.9
+
+// Tune sets GOMAXPROCS from the cgroup CPU quota and the runtime memory
+// limit from the cgroup memory limit, unless overridden by the environment.
+// It is a no-op on non-Linux platforms, when the cgroup reports no limit, or
+// when running outside a constrained cgroup.
+func Tune() {
+	tune(envOverrides())
+}
+
+type overrides struct {
+	gomaxprocs   bool
+	gomemlimit   bool
+	memlimitOff  bool
+	memoryFactor float64
+}
+
+func envOverrides() overrides {
+	factor := defaultMemoryFactor
+	if v := os.Getenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			factor = f
+		}
+	}
+
+	return overrides{
+		gomaxprocs:   os.Getenv("GOMAXPROCS") != "",
+		gomemlimit:   os.Getenv("GOMEMLIMIT") != "",
+		memlimitOff:  os.Getenv("OVIRT_IMG_AUTOMEMLIMIT") == "off",
+		memoryFactor: factor,
+	}
+}
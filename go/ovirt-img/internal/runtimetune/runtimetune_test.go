@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package runtimetune
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnvOverridesDefaults(t *testing.T) {
+	os.Unsetenv("GOMAXPROCS")
+	os.Unsetenv("GOMEMLIMIT")
+	os.Unsetenv("OVIRT_IMG_AUTOMEMLIMIT")
+	os.Unsetenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR")
+
+	o := envOverrides()
+	if o.gomaxprocs || o.gomemlimit || o.memlimitOff {
+		t.Errorf("envOverrides() = %+v, expected all false", o)
+	}
+	if o.memoryFactor != defaultMemoryFactor {
+		t.Errorf("memoryFactor = %v, expected %v", o.memoryFactor, defaultMemoryFactor)
+	}
+}
+
+func TestEnvOverridesRespectsEnv(t *testing.T) {
+	os.Setenv("GOMAXPROCS", "2")
+	defer os.Unsetenv("GOMAXPROCS")
+	os.Setenv("GOMEMLIMIT", "100MiB")
+	defer os.Unsetenv("GOMEMLIMIT")
+	os.Setenv("OVIRT_IMG_AUTOMEMLIMIT", "off")
+	defer os.Unsetenv("OVIRT_IMG_AUTOMEMLIMIT")
+
+	o := envOverrides()
+	if !o.gomaxprocs || !o.gomemlimit || !o.memlimitOff {
+		t.Errorf("envOverrides() = %+v, expected all true", o)
+	}
+}
+
+func TestEnvOverridesFactor(t *testing.T) {
+	os.Setenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR", "0.5")
+	defer os.Unsetenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR")
+
+	if o := envOverrides(); o.memoryFactor != 0.5 {
+		t.Errorf("memoryFactor = %v, expected 0.5", o.memoryFactor)
+	}
+}
+
+func TestEnvOverridesIgnoresInvalidFactor(t *testing.T) {
+	cases := []string{"not-a-number", "-1", "0"}
+	for _, v := range cases {
+		os.Setenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR", v)
+		if o := envOverrides(); o.memoryFactor != defaultMemoryFactor {
+			t.Errorf("envOverrides() with factor=%q = %v, expected default %v", v, o.memoryFactor, defaultMemoryFactor)
+		}
+	}
+	os.Unsetenv("OVIRT_IMG_AUTOMEMLIMIT_FACTOR")
+}
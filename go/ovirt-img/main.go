@@ -10,20 +10,61 @@ import (
 	"os"
 	"runtime/pprof"
 	"strings"
+
+	"ovirt.org/imageio/pipe"
+	"ovirt.org/ovirt-img/internal/runtimetune"
 )
 
 var (
 	// Common flags.
 	cpuprofile string
 
+	// TLS flags, used when connecting to an https URL.
+	cafile     string
+	clientCert string
+	clientKey  string
+	spkiPin    string
+
+	// map flags.
+	mapFormat string
+	mapFrom   uint64
+	mapLength uint64
+
+	// copy flags.
+	copyWorkers int
+
+	// upload/download flags.
+	transferWorkers  int
+	transferProgress bool
+	transferMaxRate  uint64
+
+	// upload/download dedup flags.
+	transferDedup     bool
+	transferChunkSize uint64
+	transferCacheSize int
+	transferHash      string
+
 	// Sub commands.
 	commands = map[string]*flag.FlagSet{}
 )
 
 func main() {
+	// Adjust GOMAXPROCS and the memory limit to the cgroup we run in, before
+	// any worker pools or buffers are sized.
+	runtimetune.Tune()
+
 	// Add commands flagsets.
 
 	commands["map"] = flag.NewFlagSet("map", flag.ExitOnError)
+	commands["map"].StringVar(&mapFormat, "format", "imageio", "output format: imageio, qemu")
+	commands["map"].Uint64Var(&mapFrom, "from", 0, "start of the range to map, in bytes")
+	commands["map"].Uint64Var(&mapLength, "length", 0, "length of the range to map, in bytes (0 maps to the end of the image)")
+	commands["upload"] = flag.NewFlagSet("upload", flag.ExitOnError)
+	commands["download"] = flag.NewFlagSet("download", flag.ExitOnError)
+	commands["copy"] = flag.NewFlagSet("copy", flag.ExitOnError)
+	commands["copy"].IntVar(&copyWorkers, "workers", 0, "number of concurrent connections (0 autodetects from server limits)")
+	addTransferFlags(commands["upload"])
+	addTransferFlags(commands["download"])
 	addCommonFlags()
 
 	// Parse command.
@@ -59,10 +100,28 @@ func main() {
 	switch cmdName {
 	case "map":
 		if len(cmd.Args()) != 1 {
-			fmt.Fprintln(os.Stderr, "Usage: ovirt-img map [-cpuprofile=PROF] FILE|URL")
+			fmt.Fprintln(os.Stderr, "Usage: ovirt-img map [-format=imageio|qemu] [-from=N] [-length=N] FILE|URL")
 			os.Exit(1)
 		}
-		mapURL(cmd.Arg(0))
+		mapURL(cmd.Arg(0), mapFormat, mapFrom, mapLength)
+	case "upload":
+		if len(cmd.Args()) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: ovirt-img upload [-workers=N] [-progress] [-max-rate=N] FILE URL")
+			os.Exit(1)
+		}
+		uploadFile(cmd.Arg(0), cmd.Arg(1))
+	case "download":
+		if len(cmd.Args()) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: ovirt-img download [-workers=N] [-progress] [-max-rate=N] URL FILE")
+			os.Exit(1)
+		}
+		downloadFile(cmd.Arg(0), cmd.Arg(1))
+	case "copy":
+		if len(cmd.Args()) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: ovirt-img copy [-workers=N] SRC DST")
+			os.Exit(1)
+		}
+		copyURL(cmd.Arg(0), cmd.Arg(1), copyWorkers)
 	default:
 		panic("Unexpected error")
 	}
@@ -76,8 +135,22 @@ func commandNames() []string {
 	return res
 }
 
+func addTransferFlags(cmd *flag.FlagSet) {
+	cmd.IntVar(&transferWorkers, "workers", 0, "number of concurrent connections (0 autodetects from server limits)")
+	cmd.BoolVar(&transferProgress, "progress", false, "print bytes transferred and ETA to stderr")
+	cmd.Uint64Var(&transferMaxRate, "max-rate", 0, "maximum transfer rate in bytes/s (0 for unlimited)")
+	cmd.BoolVar(&transferDedup, "dedup", false, "deduplicate repeated chunks using a content hash, using server-side copy when available (disables -workers)")
+	cmd.Uint64Var(&transferChunkSize, "chunk-size", pipe.DefaultChunkSize, "chunk size in bytes used for -dedup hashing")
+	cmd.StringVar(&transferHash, "hash", pipe.DefaultHash, "hash algorithm used for -dedup (sha256)")
+	cmd.IntVar(&transferCacheSize, "cache-size", pipe.DefaultCacheSize, "number of chunk hashes to remember for -dedup")
+}
+
 func addCommonFlags() {
 	for _, cmd := range commands {
 		cmd.StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile to file")
+		cmd.StringVar(&cafile, "cafile", "", "PEM file with CA certificates to verify the server")
+		cmd.StringVar(&clientCert, "cert", "", "PEM file with the client certificate for mutual TLS")
+		cmd.StringVar(&clientKey, "key", "", "PEM file with the client key for mutual TLS")
+		cmd.StringVar(&spkiPin, "pin", "", "base64 SHA-256 digest of the server certificate public key")
 	}
 }
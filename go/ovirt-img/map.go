@@ -13,21 +13,45 @@ import (
 	"ovirt.org/imageio"
 )
 
-func mapURL(url string) {
+func mapURL(url, format string, from, length uint64) {
 	b, err := connect(url)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 	defer b.Close()
 
-	res, err := b.Extents()
+	if length == 0 {
+		size, err := b.Size()
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		if from > size {
+			log.Fatalf("from offset %d is beyond the image size %d", from, size)
+		}
+		length = size - from
+	}
+
+	res, err := b.Extents(from, length)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 
 	w := bufio.NewWriterSize(os.Stdout, 32*1024)
-	writeExtents(w, res)
+	switch format {
+	case "imageio":
+		writeExtents(w, res)
+	case "qemu":
+		writeQemuExtents(w, res)
+	default:
+		log.Fatalf("Unsupported format: %s", format)
+	}
 	w.Flush()
+
+	if ec, ok := res.(interface{ Err() error }); ok {
+		if err := ec.Err(); err != nil {
+			log.Fatalf("%s", err)
+		}
+	}
 }
 
 // Write easy to read and compact JSON to writer.
@@ -62,3 +86,27 @@ func writeExtents(w io.Writer, res imageio.ExtentsResult) {
 
 	fmt.Fprint(w, "]\n")
 }
+
+// writeQemuExtents streams records compatible with `qemu-img map
+// --output=json`, so output can be consumed by tooling that already expects
+// that schema (for example the KubeVirt/CDI importer). Depth is always 0
+// since ovirt-img does not report backing chains. "offset" is omitted: no
+// backend in this repo reports a physical offset for an extent.
+func writeQemuExtents(w io.Writer, res imageio.ExtentsResult) {
+	first := true
+	format := "{\"start\": %v, \"length\": %v, \"depth\": 0, \"zero\": %v, \"data\": %v}"
+
+	fmt.Fprint(w, "[")
+
+	for res.Next() {
+		e := res.Value()
+		fmt.Fprintf(w, format, e.Start, e.Length, e.Zero, !e.Zero)
+
+		if first {
+			format = ",\n " + format
+			first = false
+		}
+	}
+
+	fmt.Fprint(w, "]\n")
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"ovirt.org/imageio"
+	"ovirt.org/imageio/pipe"
+	"ovirt.org/imageio/transfer"
+)
+
+// runTransfer copies src to dst using the -workers, -progress, -max-rate
+// and -dedup flags shared by the upload and download commands. -dedup
+// switches to pipe.Copy's single-connection, content-addressed copy, which
+// does not report progress and ignores -workers.
+func runTransfer(src, dst imageio.Backend, size uint64) error {
+	if transferDedup {
+		return pipe.Copy(src, dst, pipe.Options{
+			ChunkSize: transferChunkSize,
+			CacheSize: transferCacheSize,
+			Hash:      transferHash,
+		})
+	}
+
+	var progress chan transfer.Progress
+	done := make(chan struct{})
+
+	if transferProgress {
+		progress = make(chan transfer.Progress)
+		go func() {
+			defer close(done)
+			printProgress(progress, size)
+		}()
+	} else {
+		close(done)
+	}
+
+	err := transfer.Copy(src, dst, transfer.Options{
+		Workers:   transferWorkers,
+		Progress:  progress,
+		RateLimit: transferMaxRate,
+	})
+	<-done
+
+	return err
+}
+
+// printProgress prints bytes transferred and an ETA to stderr every time a
+// progress update is received, until progress is closed.
+func printProgress(progress <-chan transfer.Progress, size uint64) {
+	start := time.Now()
+
+	for p := range progress {
+		elapsed := time.Since(start)
+		eta := "unknown"
+		if p.Transferred > 0 && p.Transferred < size {
+			rate := float64(p.Transferred) / elapsed.Seconds()
+			remaining := time.Duration(float64(size-p.Transferred) / rate * float64(time.Second))
+			eta = remaining.Truncate(time.Second).String()
+		}
+		fmt.Fprintf(os.Stderr, "\r%d/%d bytes transferred, ETA %s", p.Transferred, size, eta)
+	}
+
+	fmt.Fprintln(os.Stderr)
+}
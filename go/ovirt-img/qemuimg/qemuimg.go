@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strconv"
 )
 
 type ImageInfo struct {
@@ -28,6 +29,13 @@ func Info(filename string) (*ImageInfo, error) {
 	return &info, nil
 }
 
+// Create creates a new image file in the given format with the given
+// virtual size in bytes.
+func Create(filename, format string, size uint64) error {
+	_, err := run("qemu-img", "create", "-f", format, filename, strconv.FormatUint(size, 10))
+	return err
+}
+
 func run(name string, arg ...string) ([]byte, error) {
 	cmd := exec.Command(name, arg...)
 
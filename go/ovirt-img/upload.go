@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: Red Hat, Inc.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"log"
+)
+
+// uploadFile uploads src, a local disk image, to dst, an imageio URL, using
+// up to transferWorkers concurrent connections.
+func uploadFile(src, dst string) {
+	srcBackend, err := connectFile(src)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer srcBackend.Close()
+
+	dstBackend, err := connect(dst)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer dstBackend.Close()
+
+	size, err := srcBackend.Size()
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	if err := runTransfer(srcBackend, dstBackend, size); err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	if err := dstBackend.Flush(); err != nil {
+		log.Fatalf("%s", err)
+	}
+}